@@ -0,0 +1,161 @@
+// Copyright © 2022 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package root
+
+import (
+	"time"
+
+	"github.com/carv-ics-forth/hpk/api"
+	"github.com/spf13/pflag"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Opts stores all the options for configuring the root hpk-kubelet command.
+// It is used for setting flag values.
+//
+// You can set the default options by creating a new `Opts` struct and passing
+// it into `SetDefaultOpts`
+type Opts struct {
+	// Namespace to watch for pods and other resources
+	KubeNamespace string
+	// Sets the port to listen for requests from the Kubernetes API server
+	ListenPort int32
+
+	// Node name to use when creating a node in Kubernetes
+	NodeName string
+
+	// ContainerRegistry is used to resolve images for the HPC backends that need to pull them.
+	ContainerRegistry string
+
+	ProviderConfigPath string
+
+	MetricsAddr string
+
+	// Kubeconfig resolution. Precedence follows clientcmd's
+	// ClientConfigLoadingRules: an explicit --kubeconfig wins, then
+	// $KUBECONFIG, then $HOME/.kube/config, then in-cluster config.
+	KubeConfigPath string
+	KubeContext    string
+	KubeCluster    string
+	KubeUser       string
+	APIServer      string
+
+	// QPS and Burst tune the rate limiter of the resulting rest.Config.
+	// Left at zero they fall back to the client-go defaults (5 / 10), which
+	// throttle unnecessarily on clusters with many pods per node.
+	QPS   float32
+	Burst int
+
+	// Number of workers to use to handle pod notifications
+	PodSyncWorkers       int
+	InformerResyncPeriod time.Duration
+
+	// Use node leases when supported by Kubernetes (instead of node status updates)
+	EnableNodeLease bool
+
+	// Startup Timeout is how long to wait for the kubelet to start. Zero
+	// disables startup readiness gating altogether, in which case Wait has
+	// no effect.
+	StartupTimeout time.Duration
+
+	// Wait is a set of readiness gates, evaluated concurrently under the
+	// StartupTimeout deadline, that must all pass before the node is
+	// advertised. Only takes effect when StartupTimeout > 0.
+	Wait []string
+
+	// ShutdownGracePeriod bounds how long runRootCommand waits, once a shutdown
+	// signal is received, for in-flight pods to be cleaned up before returning.
+	ShutdownGracePeriod time.Duration
+
+	DisableTaint bool
+	TaintKey     string
+	TaintValue   string
+	TaintEffect  string
+
+	// Leader election lets an active/standby pair of hpk-kubelets share a
+	// virtual node: only the elected leader advertises the node and runs the
+	// pod controller, so a standby can take over if it stops renewing.
+	LeaderElect              bool
+	LeaderElectLeaseName     string
+	LeaderElectNamespace     string
+	LeaderElectLeaseDuration time.Duration
+	LeaderElectRenewDeadline time.Duration
+	LeaderElectRetryPeriod   time.Duration
+}
+
+func installFlags(flags *pflag.FlagSet, c *Opts) {
+	flags.StringVar(&c.KubeNamespace, "namespace", api.DefaultKubeNamespace, "kubernetes namespace (default is 'all')")
+
+	flags.StringVar(&c.NodeName, "nodename", api.DefaultNodeName, "kubernetes node name")
+
+	flags.StringVar(&c.ContainerRegistry, "container-registry", api.DefaultContainerRegistry, "container registry used to resolve unqualified images")
+
+	flags.StringVar(&c.ProviderConfigPath, "provider-config", "", "HPC provider configuration file")
+	flags.StringVar(&c.MetricsAddr, "metrics-addr", api.DefaultMetricsAddr, "address to listen for metrics/stats requests")
+
+	flags.StringVar(&c.KubeConfigPath, "kubeconfig", "", "path to the kubeconfig file to use, overriding $KUBECONFIG and $HOME/.kube/config")
+	flags.StringVar(&c.KubeContext, "context", "", "name of the kubeconfig context to use")
+	flags.StringVar(&c.KubeCluster, "cluster", "", "name of the kubeconfig cluster to use")
+	flags.StringVar(&c.KubeUser, "user", "", "name of the kubeconfig auth-info (user) to use")
+	flags.StringVar(&c.APIServer, "api-server", "", "kube-apiserver URL, overriding the one in the selected kubeconfig context")
+
+	flags.Float32Var(&c.QPS, "qps", 0, "QPS to use for the Kubernetes client (0 keeps the client-go default)")
+	flags.IntVar(&c.Burst, "burst", 0, "burst to use for the Kubernetes client (0 keeps the client-go default)")
+
+	flags.IntVar(&c.PodSyncWorkers, "pod-sync-workers", api.DefaultPodSyncWorkers, `set the number of pod synchronization workers`)
+	flags.BoolVar(&c.EnableNodeLease, "enable-node-lease", true, `use node leases (1.13) for node heartbeats`)
+
+	flags.DurationVar(&c.InformerResyncPeriod, "full-resync-period", api.DefaultInformerResyncPeriod, "how often to perform a full resync of pods between kubernetes and the provider")
+	flags.DurationVar(&c.StartupTimeout, "startup-timeout", 0, "How long to wait for the virtual-kubelet to start; 0 disables startup readiness gating entirely (--wait is then ignored)")
+	flags.StringSliceVar(&c.Wait, "wait", []string{"pod_controller"}, "comma-separated readiness gates to satisfy before advertising the node (pod_controller, node_ready, dns_resolvable, apiserver_reachable, default_sa, informers_synced); only takes effect when --startup-timeout is set above 0")
+	flags.DurationVar(&c.ShutdownGracePeriod, "shutdown-grace-period", 30*time.Second, "How long to wait for in-flight pods to be cleaned up after a shutdown signal before the virtual-kubelet exits")
+
+	flags.BoolVar(&c.DisableTaint, "disable-taint", false, "disable the virtual-kubelet node taint")
+
+	flags.StringVar(&c.TaintKey, "taint-key", api.DefaultTaintKey, "Set node taint key")
+	flags.StringVar(&c.TaintValue, "taint-value", api.DefaultTaintValue, "Set node taint value")
+	flags.StringVar(&c.TaintEffect, "taint-effect", api.DefaultTaintEffect, "Set node taint effect")
+
+	flags.BoolVar(&c.LeaderElect, "leader-elect", false, "enable leader election so an active/standby pair of hpk-kubelets can share a virtual node")
+	flags.StringVar(&c.LeaderElectLeaseName, "leader-elect-lease-name", "", "name of the lease object used for leader election (defaults to '<nodename>-hpk')")
+	flags.StringVar(&c.LeaderElectNamespace, "leader-elect-namespace", api.DefaultKubeNamespace, "namespace of the lease object used for leader election")
+	flags.DurationVar(&c.LeaderElectLeaseDuration, "leader-elect-lease-duration", 15*time.Second, "duration non-leader candidates wait before forcing acquisition of the leader-election lease")
+	flags.DurationVar(&c.LeaderElectRenewDeadline, "leader-elect-renew-deadline", 10*time.Second, "duration the leader retries refreshing its leader-election lease before giving it up")
+	flags.DurationVar(&c.LeaderElectRetryPeriod, "leader-elect-retry-period", 2*time.Second, "duration candidates wait between actions to acquire or renew the leader-election lease")
+}
+
+// getTaint creates a taint using the provided key/value.
+// Taint effect is read from the environment
+// The taint key/value may be overwritten by the environment.
+func getTaint(o Opts) (*corev1.Taint, error) {
+	var effect corev1.TaintEffect
+	switch o.TaintEffect {
+	case "NoSchedule":
+		effect = corev1.TaintEffectNoSchedule
+	case "NoExecute":
+		effect = corev1.TaintEffectNoExecute
+	case "PreferNoSchedule":
+		effect = corev1.TaintEffectPreferNoSchedule
+	default:
+		return nil, errdefs.InvalidInputf("taint effect %q is not supported", o.TaintEffect)
+	}
+
+	return &corev1.Taint{
+		Key:    o.TaintKey,
+		Value:  o.TaintValue,
+		Effect: effect,
+	}, nil
+}
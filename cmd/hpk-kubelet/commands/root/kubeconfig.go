@@ -0,0 +1,73 @@
+// Copyright © 2022 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package root
+
+import (
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// buildRestConfig resolves a *rest.Config honouring the --kubeconfig,
+// --context, --cluster, --user, and --api-server flags.
+//
+// Precedence (via clientcmd's ClientConfigLoadingRules):
+//
+//   - --kubeconfig flag pointing at a file
+//
+//   - KUBECONFIG environment variable pointing at a file (or list of files)
+//
+//   - $HOME/.kube/config if it exists
+//
+//   - In-cluster config, if none of the above resolve to a file
+//
+// --context/--cluster/--user select among the entries of whichever
+// kubeconfig was loaded; --api-server overrides the server URL of the
+// resulting config, which is useful on HPC login nodes that otherwise carry
+// working credentials for a cluster behind a different front-end address.
+func buildRestConfig(c Opts) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if c.KubeConfigPath != "" {
+		loadingRules.ExplicitPath = c.KubeConfigPath
+	}
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: c.KubeContext,
+		Context: clientcmd.Context{
+			Cluster:  c.KubeCluster,
+			AuthInfo: c.KubeUser,
+		},
+	}
+
+	if c.APIServer != "" {
+		overrides.ClusterInfo.Server = c.APIServer
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.QPS > 0 {
+		cfg.QPS = c.QPS
+	}
+
+	if c.Burst > 0 {
+		cfg.Burst = c.Burst
+	}
+
+	return cfg, nil
+}
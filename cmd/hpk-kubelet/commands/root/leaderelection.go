@@ -0,0 +1,139 @@
+// Copyright © 2022 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package root
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+// acquireSignalGracePeriod bounds how long OnStoppedLeading waits for the
+// close(started) signal from a just-scheduled OnStartedLeading goroutine
+// before concluding that the lease was never acquired. See the comment in
+// OnStoppedLeading below for why this can't be a simple non-blocking check.
+const acquireSignalGracePeriod = 2 * time.Second
+
+// runWithLeaderElection wraps runVirtualNode in leader election, so that only
+// one of an active/standby pair of hpk-kubelets advertises the virtual node
+// and runs the pod controller at any given time. Losing the lease (or ctx
+// being cancelled) tears the virtual node down via the same graceful-shutdown
+// path used outside of leader election, then exits non-zero so that whatever
+// process manager is supervising hpk-kubelet restarts it as a follower.
+func runWithLeaderElection(ctx context.Context, log logr.Logger, client kubernetes.Interface, eb record.EventBroadcaster, c Opts) error {
+	leaseName := c.LeaderElectLeaseName
+	if leaseName == "" {
+		leaseName = c.NodeName + "-hpk"
+	}
+
+	identity := fmt.Sprintf("%s_%s", c.NodeName, uuid.NewUUID())
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaseName,
+			Namespace: c.LeaderElectNamespace,
+		},
+		Client: client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity:      identity,
+			EventRecorder: eb.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "hpk-kubelet-leader-election"}),
+		},
+	}
+
+	// started is closed the moment OnStartedLeading begins, so OnStoppedLeading
+	// can tell whether we ever actually led (client-go calls OnStoppedLeading
+	// on every exit from Run, including when ctx is cancelled before the lease
+	// was ever acquired).
+	started := make(chan struct{})
+
+	// leaderDone is closed once runVirtualNode returns. client-go runs
+	// OnStartedLeading in its own goroutine and does not wait for it before
+	// running OnStoppedLeading, so without this, the graceful-shutdown path
+	// inside runVirtualNode races an os.Exit in OnStoppedLeading; closing
+	// leaderDone after writing runErr also makes the later `return runErr`
+	// happens-after that write instead of racing it.
+	leaderDone := make(chan struct{})
+
+	var runErr error
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   c.LeaderElectLeaseDuration,
+		RenewDeadline:   c.LeaderElectRenewDeadline,
+		RetryPeriod:     c.LeaderElectRetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				close(started)
+				log.Info("Acquired leader-election lease", "identity", identity)
+				runErr = runVirtualNode(ctx, log, client, eb, c)
+				close(leaderDone)
+			},
+			OnStoppedLeading: func() {
+				// client-go schedules the OnStartedLeading goroutine and then
+				// immediately enters its renew loop; OnStoppedLeading only
+				// fires once that loop exits, which happens either because
+				// the lease was never acquired (OnStartedLeading never ran)
+				// or because renewal failed/ctx was cancelled after it did.
+				// Scheduling the goroutine doesn't guarantee close(started)
+				// has executed by the time we get here, so a plain
+				// non-blocking check would race a just-started goroutine.
+				// Any renew loop that actually ran takes at least one API
+				// round trip, far longer than this wait, so give it a brief
+				// grace period before concluding we never led.
+				select {
+				case <-started:
+					// We did acquire the lease at some point; wait for
+					// runVirtualNode's graceful shutdown to actually finish
+					// before deciding what to do next.
+					<-leaderDone
+				case <-time.After(acquireSignalGracePeriod):
+					// ctx was cancelled before we ever acquired the lease;
+					// there's nothing to clean up.
+					return
+				}
+
+				if ctx.Err() != nil {
+					// A normal shutdown (e.g. SIGTERM), not a lost race against
+					// another candidate: let runWithLeaderElection return runErr
+					// through the usual path instead of exiting the process here.
+					log.Info("Leader election stopped for shutdown", "identity", identity)
+					return
+				}
+
+				log.Info("Lost leader-election lease to another candidate; exiting so a standby can take over", "identity", identity)
+				os.Exit(1)
+			},
+			OnNewLeader: func(currentIdentity string) {
+				if currentIdentity != identity {
+					log.Info("New hpk-kubelet leader elected", "identity", currentIdentity)
+				}
+			},
+		},
+	})
+
+	return runErr
+}
@@ -0,0 +1,236 @@
+// Copyright © 2022 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package root
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const readinessPollInterval = time.Second
+
+// readinessGate is a single precondition that must hold before the virtual
+// node is advertised as Ready. Gates are selected via the --wait flag and
+// run concurrently under the shared --startup-timeout deadline.
+type readinessGate interface {
+	// Name identifies the gate, matching the keyword used to select it via --wait.
+	Name() string
+
+	// Wait blocks until the gate's precondition is satisfied, or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// readinessDeps bundles everything a readinessGate may need to evaluate itself.
+type readinessDeps struct {
+	client    kubernetes.Interface
+	namespace string
+	nodeName  string
+	dnsIP     string
+	informers []cache.InformerSynced
+	podReady  <-chan struct{}
+}
+
+// buildReadinessGates turns the comma-separated --wait keywords into the
+// readinessGate implementations that evaluate them.
+func buildReadinessGates(keywords []string, deps readinessDeps) ([]readinessGate, error) {
+	gates := make([]readinessGate, 0, len(keywords))
+
+	for _, keyword := range keywords {
+		switch keyword {
+		case "pod_controller":
+			gates = append(gates, podControllerGate{ready: deps.podReady})
+		case "node_ready":
+			gates = append(gates, nodeReadyGate{client: deps.client, nodeName: deps.nodeName})
+		case "dns_resolvable":
+			gates = append(gates, dnsResolvableGate{dnsIP: deps.dnsIP})
+		case "apiserver_reachable":
+			gates = append(gates, apiserverReachableGate{client: deps.client})
+		case "default_sa":
+			gates = append(gates, defaultSAGate{client: deps.client, namespace: deps.namespace})
+		case "informers_synced":
+			gates = append(gates, informersSyncedGate{informers: deps.informers})
+		default:
+			return nil, errors.Errorf("unknown --wait gate %q", keyword)
+		}
+	}
+
+	return gates, nil
+}
+
+// waitForGates runs every gate concurrently and fails fast as soon as one of
+// them returns an error, or ctx's deadline is exceeded.
+func waitForGates(ctx context.Context, gates []readinessGate) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	for _, gate := range gates {
+		gate := gate
+		group.Go(func() error {
+			if err := gate.Wait(groupCtx); err != nil {
+				return errors.Wrapf(err, "readiness gate %q failed", gate.Name())
+			}
+
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// podControllerGate waits for the pod controller to report it has processed
+// its initial set of pods.
+type podControllerGate struct {
+	ready <-chan struct{}
+}
+
+func (g podControllerGate) Name() string { return "pod_controller" }
+
+func (g podControllerGate) Wait(ctx context.Context) error {
+	select {
+	case <-g.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nodeReadyGate waits for a Node object of the given name to report
+// Ready=True. This requires the node controller to already be running
+// concurrently with gate evaluation (it's what creates the Node on first
+// registration and pushes its Ready condition) — without that, this gate
+// would poll a Node that doesn't exist yet and run out the startup-timeout
+// clock even on a perfectly healthy fresh registration. It's most useful
+// when a standby hpk-kubelet is taking over for one that registered the node
+// previously, but also holds for a brand-new node once the controller starts.
+type nodeReadyGate struct {
+	client   kubernetes.Interface
+	nodeName string
+}
+
+func (g nodeReadyGate) Name() string { return "node_ready" }
+
+func (g nodeReadyGate) Wait(ctx context.Context) error {
+	return wait.PollImmediateUntilWithContext(ctx, readinessPollInterval, func(ctx context.Context) (bool, error) {
+		n, err := g.client.CoreV1().Nodes().Get(ctx, g.nodeName, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		for _, cond := range n.Status.Conditions {
+			if cond.Type == corev1.NodeReady && cond.Status == corev1.ConditionTrue {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+}
+
+// dnsResolvableGate waits until the discovered cluster DNS server answers a
+// UDP lookup, i.e. CoreDNS/kube-dns is actually serving queries.
+type dnsResolvableGate struct {
+	dnsIP string
+}
+
+func (g dnsResolvableGate) Name() string { return "dns_resolvable" }
+
+func (g dnsResolvableGate) Wait(ctx context.Context) error {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, "udp", net.JoinHostPort(g.dnsIP, "53"))
+		},
+	}
+
+	return wait.PollImmediateUntilWithContext(ctx, readinessPollInterval, func(ctx context.Context) (bool, error) {
+		if _, err := resolver.LookupHost(ctx, "kubernetes.default.svc.cluster.local"); err != nil {
+			return false, nil
+		}
+
+		return true, nil
+	})
+}
+
+// apiserverReachableGate waits until the kube-apiserver responds to a basic
+// discovery call.
+type apiserverReachableGate struct {
+	client kubernetes.Interface
+}
+
+func (g apiserverReachableGate) Name() string { return "apiserver_reachable" }
+
+func (g apiserverReachableGate) Wait(ctx context.Context) error {
+	return wait.PollImmediateUntilWithContext(ctx, readinessPollInterval, func(ctx context.Context) (bool, error) {
+		if _, err := g.client.Discovery().ServerVersion(); err != nil {
+			return false, nil
+		}
+
+		return true, nil
+	})
+}
+
+// defaultSAGate waits for the default ServiceAccount to exist in the watched
+// namespace, so that pods which rely on it aren't admitted before it's there.
+type defaultSAGate struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func (g defaultSAGate) Name() string { return "default_sa" }
+
+func (g defaultSAGate) Wait(ctx context.Context) error {
+	return wait.PollImmediateUntilWithContext(ctx, readinessPollInterval, func(ctx context.Context) (bool, error) {
+		_, err := g.client.CoreV1().ServiceAccounts(g.namespace).Get(ctx, "default", metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		return true, nil
+	})
+}
+
+// informersSyncedGate waits for the given shared informers to complete their
+// initial list-and-watch sync.
+type informersSyncedGate struct {
+	informers []cache.InformerSynced
+}
+
+func (g informersSyncedGate) Name() string { return "informers_synced" }
+
+func (g informersSyncedGate) Wait(ctx context.Context) error {
+	if !cache.WaitForCacheSync(ctx.Done(), g.informers...) {
+		return errors.New("informers did not sync")
+	}
+
+	return nil
+}
@@ -18,15 +18,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
-	"time"
+	"syscall"
 
 	"github.com/carv-ics-forth/hpk/cmd/hpk-kubelet/commands"
 	"github.com/carv-ics-forth/hpk/compute"
 	"github.com/carv-ics-forth/hpk/pkg/resourcemanager"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
 	"github.com/carv-ics-forth/hpk/provider"
+	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -39,6 +40,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -71,21 +73,18 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		"watchedNamespace", c.KubeNamespace,
 	)
 
+	// Intercept SIGINT/SIGTERM so that, instead of dropping everything on the
+	// floor, we get a chance to cordon the node, release its lease, and drain
+	// in-flight pods before the process exits.
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	/*---------------------------------------------------
 	 * Starting Kubernetes Client
 	 *---------------------------------------------------*/
 	log.Info(" Starting Kubernetes Client")
 
-	// Config precedence
-	//
-	// * --kubeconfig flag pointing at a file
-	//
-	// * KUBECONFIG environment variable pointing at a file
-	//
-	// * In-cluster config if running in cluster
-	//
-	// * $HOME/.kube/config if exists.
-	cfg, err := config.GetConfig()
+	cfg, err := buildRestConfig(c)
 	if err != nil {
 		return errors.Wrapf(err, "unable to get kubeconfig")
 	}
@@ -95,6 +94,21 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		return errors.Wrapf(err, "unable to start kubernetes client")
 	}
 
+	eb := record.NewBroadcaster()
+	eb.StartLogging(logrus.Infof)
+	eb.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: client.CoreV1().Events(c.KubeNamespace)})
+
+	if !c.LeaderElect {
+		return runVirtualNode(ctx, log, client, eb, c)
+	}
+
+	return runWithLeaderElection(ctx, log, client, eb, c)
+}
+
+// runVirtualNode builds the virtual node and runs it until ctx is done, then
+// performs a graceful shutdown. It is the workload that either runs directly
+// or, when --leader-elect is set, only while holding the leader-election lease.
+func runVirtualNode(ctx context.Context, log logr.Logger, client kubernetes.Interface, eb record.EventBroadcaster, c Opts) error {
 	/*---------------------------------------------------
 	 * Load Kubernetes Informers
 	 *---------------------------------------------------*/
@@ -241,9 +255,21 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		return errors.Wrap(err, "cannot start node controller")
 	}
 
-	eb := record.NewBroadcaster()
-	eb.StartLogging(logrus.Infof)
-	eb.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: client.CoreV1().Events(c.KubeNamespace)})
+	// Run the node controller concurrently with everything below rather than
+	// blocking on it after the readiness gates: it's nodeController.Run that
+	// actually creates the Node object on first registration (via
+	// WithNodeStatusUpdateErrorHandler above) and pushes its Ready condition,
+	// so the node_ready gate needs this already running to ever observe
+	// anything but a not-found/not-ready node.
+	nodeControllerDone := make(chan struct{})
+	go func() {
+		defer close(nodeControllerDone)
+
+		if err := nodeController.Run(ctx); err != nil && errors.Cause(err) != context.Canceled {
+			log.Error(err, "node controller failed")
+			os.Exit(-1)
+		}
+	}()
 
 	/*---------------------------------------------------
 	 * Start the controller for the Virtual Node
@@ -263,7 +289,10 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		return errors.Wrap(err, "error setting up pod controller")
 	}
 
+	podControllerDone := make(chan struct{})
 	go func() {
+		defer close(podControllerDone)
+
 		if err := podController.Run(ctx, c.PodSyncWorkers); err != nil && errors.Cause(err) != context.Canceled {
 			log.Error(err, "pod controller failed")
 			os.Exit(-1)
@@ -274,28 +303,42 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		// If there is a startup timeout, it does two things:
 		// 1. It causes the VK to shut down if we haven't gotten into an operational state in a time period
 		// 2. It prevents node advertisement from happening until we're in an operational state
-		err = waitFor(ctx, c.StartupTimeout, podController.Ready())
+		gates, err := buildReadinessGates(c.Wait, readinessDeps{
+			client:    client,
+			namespace: c.KubeNamespace,
+			nodeName:  c.NodeName,
+			dnsIP:     dnsIP.IP,
+			informers: []cache.InformerSynced{
+				podInformer.Informer().HasSynced,
+				secretInformer.Informer().HasSynced,
+				configMapInformer.Informer().HasSynced,
+				serviceInformer.Informer().HasSynced,
+			},
+			podReady: podController.Ready(),
+		})
 		if err != nil {
 			return err
 		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, c.StartupTimeout)
+		err = waitForGates(waitCtx, gates)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "error while starting up hpk-kubelet")
+		}
 	}
 
-	return nodeController.Run(ctx)
-}
+	<-ctx.Done()
+	<-nodeControllerDone
 
-func waitFor(ctx context.Context, time time.Duration, ready <-chan struct{}) error {
-	ctx, cancel := context.WithTimeout(ctx, time)
-	defer cancel()
+	/*---------------------------------------------------
+	 * Gracefully shut down: cordon, release the lease, and drain pods
+	 *---------------------------------------------------*/
+	log.Info("Shutting down")
 
-	// Wait for the VK / PC close the ready channel, or time out and return
-	logrus.Warn("Waiting for pod controller / VK to be ready")
+	gracefulShutdown(log, client, pNode, newProvider, podControllerDone, c)
 
-	select {
-	case <-ready:
-		return nil
-	case <-ctx.Done():
-		return errors.Wrap(ctx.Err(), "Error while starting up VK")
-	}
+	return nil
 }
 
 func envOr(name, alt string) string {
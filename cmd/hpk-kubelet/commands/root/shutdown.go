@@ -0,0 +1,214 @@
+// Copyright © 2022 FORTH-ICS
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package root
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// cordonAndTaint marks the node as unschedulable and adds a NoSchedule taint so
+// that the scheduler stops admitting new pods to it while the kubelet shuts down.
+func cordonAndTaint(ctx context.Context, log logr.Logger, client kubernetes.Interface, pNode *corev1.Node) error {
+	log.Info("Cordoning node for shutdown")
+
+	current, err := client.CoreV1().Nodes().Get(ctx, pNode.Name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+
+		return errors.Wrap(err, "unable to fetch node for cordon")
+	}
+
+	current.Spec.Unschedulable = true
+	current.Spec.Taints = append(current.Spec.Taints, corev1.Taint{
+		Key:    "hpk.io/shutting-down",
+		Effect: corev1.TaintEffectNoSchedule,
+	})
+
+	if _, err := client.CoreV1().Nodes().Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrap(err, "unable to cordon node")
+	}
+
+	return nil
+}
+
+// markNodeNotReady flips the node's Ready condition to False so that the scheduler
+// and other consumers of the Node object stop treating it as available.
+func markNodeNotReady(ctx context.Context, log logr.Logger, client kubernetes.Interface, nodeName string) error {
+	log.Info("Marking node as not-ready for shutdown")
+
+	current, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+
+		return errors.Wrap(err, "unable to fetch node for status update")
+	}
+
+	now := metav1.Now()
+	updated := false
+
+	for i := range current.Status.Conditions {
+		if current.Status.Conditions[i].Type != corev1.NodeReady {
+			continue
+		}
+
+		current.Status.Conditions[i].Status = corev1.ConditionFalse
+		current.Status.Conditions[i].Reason = "Terminating"
+		current.Status.Conditions[i].Message = "hpk-kubelet is shutting down"
+		current.Status.Conditions[i].LastTransitionTime = now
+		updated = true
+	}
+
+	if !updated {
+		current.Status.Conditions = append(current.Status.Conditions, corev1.NodeCondition{
+			Type:               corev1.NodeReady,
+			Status:             corev1.ConditionFalse,
+			Reason:             "Terminating",
+			Message:            "hpk-kubelet is shutting down",
+			LastTransitionTime: now,
+		})
+	}
+
+	if _, err := client.CoreV1().Nodes().UpdateStatus(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrap(err, "unable to mark node as not-ready")
+	}
+
+	return nil
+}
+
+// releaseNodeLease deletes the coordination.k8s.io/v1 Lease backing this node's
+// heartbeat, instead of waiting for it to expire, so a replacement hpk-kubelet
+// can be recognised as the new holder immediately.
+func releaseNodeLease(ctx context.Context, log logr.Logger, client kubernetes.Interface, nodeName string) error {
+	log.Info("Releasing node lease")
+
+	err := client.CoordinationV1().Leases(corev1.NamespaceNodeLease).Delete(ctx, nodeName, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrap(err, "unable to release node lease")
+	}
+
+	return nil
+}
+
+// forceKillGracePeriod bounds the force-kill fallback independently of
+// --shutdown-grace-period: that budget has already been spent by the time
+// force-kill runs (it only triggers once shutdownCtx is done), so reusing it
+// again would let worst-case shutdown take ~2x the configured period. This is
+// a short fixed ceiling rather than another configurable full-length period.
+const forceKillGracePeriod = 5 * time.Second
+
+// PodForceKiller is implemented by providers that can forcibly terminate any
+// pods they still have running, bypassing their normal (graceful) teardown.
+// gracefulShutdown calls it once the shutdown grace period elapses without
+// the pod controller draining on its own, so that stuck pods are cleaned up
+// rather than abandoned.
+type PodForceKiller interface {
+	ForceKillAllPods(ctx context.Context) error
+}
+
+// waitForPodControllerDrain blocks until podControllerDone is closed (meaning
+// the pod controller's workqueue has been fully drained and its workers have
+// returned) or ctx is done, whichever happens first. ctx is expected to carry
+// whatever remains of the overall --shutdown-grace-period deadline, rather
+// than a fresh timer of its own, so that the node-state updates that precede
+// this and the drain itself share a single grace-period budget. If ctx is
+// done first and the provider supports it, it force-kills any pods still
+// running instead of leaving them behind, bounded by forceKillGracePeriod so
+// a stuck force-kill can't hang shutdown indefinitely.
+func waitForPodControllerDrain(ctx context.Context, log logr.Logger, provider interface{}, podControllerDone <-chan struct{}) {
+	log.Info("Waiting for pod controller to drain in-flight pods")
+
+	select {
+	case <-podControllerDone:
+		log.Info("Pod controller drained")
+		return
+	case <-ctx.Done():
+	}
+
+	log.Info("Shutdown grace period elapsed before pod controller fully drained; force-killing remaining pods")
+
+	killer, ok := provider.(PodForceKiller)
+	if !ok {
+		log.Info("Provider does not support force-killing pods; abandoning remaining in-flight pods")
+		return
+	}
+
+	// ctx is already done by this point (that's why we're here), so the
+	// force-kill gets its own bounded deadline rather than one that's already
+	// expired or one with no bound at all that could hang shutdown forever.
+	forceKillCtx, cancel := context.WithTimeout(context.Background(), forceKillGracePeriod)
+	defer cancel()
+
+	if err := killer.ForceKillAllPods(forceKillCtx); err != nil {
+		log.Error(err, "failed to force-kill remaining pods during shutdown")
+	}
+}
+
+// gracefulShutdown cordons the virtual node, stops advertising it as ready,
+// releases its coordination lease, and waits for the pod controller to drain
+// in-flight pods (force-killing them via the provider if the grace period
+// elapses first) before runRootCommand returns. It is invoked once a shutdown
+// signal has been received and uses its own deadline so that cleanup can still
+// complete even though the command's context has already been cancelled.
+func gracefulShutdown(log logr.Logger, client kubernetes.Interface, pNode *corev1.Node, provider interface{}, podControllerDone <-chan struct{}, c Opts) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), c.ShutdownGracePeriod)
+	defer cancel()
+
+	// Cordon, not-ready, and lease-release are independent API calls, so run
+	// them concurrently instead of eating into the shared grace-period budget
+	// three times over. A plain errgroup.Group (no WithContext) is used on
+	// purpose: each call keeps its own independent failure handling rather
+	// than one failing call cancelling the others' in-flight requests.
+	var group errgroup.Group
+
+	group.Go(func() error {
+		if err := cordonAndTaint(shutdownCtx, log, client, pNode); err != nil {
+			log.Error(err, "failed to cordon node during shutdown")
+		}
+		return nil
+	})
+
+	group.Go(func() error {
+		if err := markNodeNotReady(shutdownCtx, log, client, pNode.Name); err != nil {
+			log.Error(err, "failed to mark node as not-ready during shutdown")
+		}
+		return nil
+	})
+
+	if c.EnableNodeLease {
+		group.Go(func() error {
+			if err := releaseNodeLease(shutdownCtx, log, client, pNode.Name); err != nil {
+				log.Error(err, "failed to release node lease during shutdown")
+			}
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	waitForPodControllerDrain(shutdownCtx, log, provider, podControllerDone)
+}